@@ -26,20 +26,25 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/opstrace/opstrace/go/cmd/config/actions"
+	"github.com/opstrace/opstrace/go/pkg/middleware"
 )
 
 type HasuraHandler struct {
 	alertmanagerURL *url.URL
 	expectedSecret  string
+	readOnly        bool
 }
 
+// If `readOnly` is true, actions that would change the configuration in Cortex are rejected.
 func NewHasuraHandler(
 	alertmanagerURL *url.URL,
 	expectedSecret string,
+	readOnly bool,
 ) *HasuraHandler {
 	return &HasuraHandler{
 		alertmanagerURL,
 		expectedSecret,
+		readOnly,
 	}
 }
 
@@ -67,6 +72,13 @@ func (h *HasuraHandler) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if h.readOnly && isMutatingAction(actionName) {
+		writeGraphQLError(w, fmt.Sprintf("%s not allowed: server is in read-only mode", actionName))
+		return
+	}
+
+	logger := middleware.Logger(r.Context())
+
 	// use action name to decide how to unmarshal the input
 	var response interface{}
 	switch actionName {
@@ -80,7 +92,7 @@ func (h *HasuraHandler) handler(w http.ResponseWriter, r *http.Request) {
 
 		// see https://cortexmetrics.io/docs/api/#get-alertmanager-configuration
 		httpresp, err := h.cortexQuery(request.Input.TenantID, "GET", "/api/v1/alerts", "")
-		response, err = toGetAlertmanagerResponse(request.Input.TenantID, httpresp, err)
+		response, err = toGetAlertmanagerResponse(logger, request.Input.TenantID, httpresp, err)
 		if err != nil {
 			writeGraphQLError(w, err.Error())
 			return
@@ -111,7 +123,7 @@ func (h *HasuraHandler) handler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		httpresp, err := h.cortexQuery(request.Input.TenantID, "GET", "/api/v1/rules", "")
-		response, err = toListRulesResponse(request.Input.TenantID, httpresp, err)
+		response, err = toListRulesResponse(logger, request.Input.TenantID, httpresp, err)
 		if err != nil {
 			writeGraphQLError(w, err.Error())
 			return
@@ -128,6 +140,7 @@ func (h *HasuraHandler) handler(w http.ResponseWriter, r *http.Request) {
 		path := fmt.Sprintf("/api/v1/rules/%s/%s", request.Input.Namespace, request.Input.RuleGroupName)
 		httpresp, err := h.cortexQuery(request.Input.TenantID, "GET", path, "")
 		response, err = toGetRuleGroupResponse(
+			logger,
 			request.Input.TenantID,
 			request.Input.Namespace,
 			request.Input.RuleGroupName,
@@ -174,12 +187,17 @@ func (h *HasuraHandler) handler(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
-func toGetAlertmanagerResponse(tenantID string, httpresp *http.Response, err error) (*actions.Alertmanager, error) {
+func toGetAlertmanagerResponse(
+	logger *log.Entry,
+	tenantID string,
+	httpresp *http.Response,
+	err error,
+) (*actions.Alertmanager, error) {
 	if err != nil {
 		switch {
 		case httpresp == nil:
 			// Network failure
-			log.Warnf("Failed to retrieve alertmanager config for tenant %s: %s", tenantID, err.Error())
+			logger.WithField("tenant", tenantID).Warnf("Failed to retrieve alertmanager config: %s", err.Error())
 			return &actions.Alertmanager{
 				TenantID: tenantID,
 				Config:   nil,
@@ -195,7 +213,7 @@ func toGetAlertmanagerResponse(tenantID string, httpresp *http.Response, err err
 			}, nil
 		default:
 			// Other HTTP error (e.g. serialization/storage error)
-			log.Warnf("Error when retrieving alertmanager config for tenant %s: %s", tenantID, err.Error())
+			logger.WithField("tenant", tenantID).Warnf("Error when retrieving alertmanager config: %s", err.Error())
 			return &actions.Alertmanager{
 				TenantID: tenantID,
 				Config:   nil,
@@ -217,12 +235,17 @@ func toGetAlertmanagerResponse(tenantID string, httpresp *http.Response, err err
 	}
 }
 
-func toListRulesResponse(tenantID string, httpresp *http.Response, err error) (*actions.Rules, error) {
+func toListRulesResponse(
+	logger *log.Entry,
+	tenantID string,
+	httpresp *http.Response,
+	err error,
+) (*actions.Rules, error) {
 	if err != nil {
 		switch {
 		case httpresp == nil:
 			// Network failure
-			log.Warnf("Failed to retrieve rules for tenant %s: %s", tenantID, err.Error())
+			logger.WithField("tenant", tenantID).Warnf("Failed to retrieve rules: %s", err.Error())
 			return &actions.Rules{
 				TenantID: tenantID,
 				Rules:    nil,
@@ -238,7 +261,7 @@ func toListRulesResponse(tenantID string, httpresp *http.Response, err error) (*
 			}, nil
 		default:
 			// Other HTTP error (e.g. serialization/storage error)
-			log.Warnf("Error when retrieving rules for tenant %s: %s", tenantID, err.Error())
+			logger.WithField("tenant", tenantID).Warnf("Error when retrieving rules: %s", err.Error())
 			return &actions.Rules{
 				TenantID: tenantID,
 				Rules:    nil,
@@ -260,6 +283,7 @@ func toListRulesResponse(tenantID string, httpresp *http.Response, err error) (*
 }
 
 func toGetRuleGroupResponse(
+	logger *log.Entry,
 	tenantID string,
 	namespace string,
 	ruleGroupName string,
@@ -270,13 +294,11 @@ func toGetRuleGroupResponse(
 		switch {
 		case httpresp == nil:
 			// Network failure
-			log.Warnf(
-				"Failed to retrieve rule group %s/%s for tenant %s: %s",
-				namespace,
-				ruleGroupName,
-				tenantID,
-				err.Error(),
-			)
+			logger.WithFields(log.Fields{
+				"tenant":    tenantID,
+				"namespace": namespace,
+				"group":     ruleGroupName,
+			}).Warnf("Failed to retrieve rule group: %s", err.Error())
 			return &actions.RuleGroup{
 				TenantID:      tenantID,
 				Namespace:     namespace,
@@ -296,13 +318,11 @@ func toGetRuleGroupResponse(
 			}, nil
 		default:
 			// Other HTTP error (e.g. serialization/storage error)
-			log.Warnf(
-				"Error when retrieving rule group %s/%s for tenant %s: %s",
-				namespace,
-				ruleGroupName,
-				tenantID,
-				err.Error(),
-			)
+			logger.WithFields(log.Fields{
+				"tenant":    tenantID,
+				"namespace": namespace,
+				"group":     ruleGroupName,
+			}).Warnf("Error when retrieving rule group: %s", err.Error())
 			return &actions.RuleGroup{
 				TenantID:      tenantID,
 				Namespace:     namespace,
@@ -353,6 +373,16 @@ func (h *HasuraHandler) cortexQuery(tenant, method, path, body string) (*http.Re
 	return resp, nil
 }
 
+// Returns whether the action writes to or deletes from the configuration in Cortex.
+func isMutatingAction(actionName string) bool {
+	switch actionName {
+	case "updateAlertmanager", "updateRuleGroup", "deleteRuleGroup":
+		return true
+	default:
+		return false
+	}
+}
+
 func writeGraphQLError(w http.ResponseWriter, err string) {
 	errorObject := actions.GraphQLError{
 		Message: err,
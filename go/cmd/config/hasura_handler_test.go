@@ -0,0 +1,79 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasuraHandler_readOnly(t *testing.T) {
+	var cortexRequests []string
+	cortex := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cortexRequests = append(cortexRequests, r.Method+" "+r.URL.Path)
+	}))
+	defer cortex.Close()
+	cortexURL, err := url.Parse(cortex.URL)
+	assert.NoError(t, err)
+
+	handler := NewHasuraHandler(cortexURL, "secret", true)
+
+	tests := []struct {
+		action        string
+		input         string
+		expectedCode  int
+		expectedQuery string
+	}{
+		{"getAlertmanager", `{"tenant_id": "dev"}`, http.StatusOK, "GET /api/v1/alerts"},
+		{"listRules", `{"tenant_id": "dev"}`, http.StatusOK, "GET /api/v1/rules"},
+		{"updateAlertmanager", `{"tenant_id": "dev", "input": {"config": "foo"}}`, http.StatusBadRequest, ""},
+		{"updateAlertmanager", `{"tenant_id": "dev"}`, http.StatusBadRequest, ""},
+		{
+			"updateRuleGroup",
+			`{"tenant_id": "dev", "namespace": "ns", "rule_group": {"rule_group": "foo"}}`,
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"deleteRuleGroup",
+			`{"tenant_id": "dev", "namespace": "ns", "rule_group_name": "group"}`,
+			http.StatusBadRequest,
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		cortexRequests = nil
+		body := fmt.Sprintf(`{"action": {"name": %q}, "input": %s}`, tt.action, tt.input)
+		r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		r.Header.Set(actionSecretHeaderName, "secret")
+		w := httptest.NewRecorder()
+		handler.handler(w, r)
+
+		assert.Equal(t, tt.expectedCode, w.Code, tt.action)
+		if tt.expectedQuery == "" {
+			assert.Empty(t, cortexRequests, tt.action)
+			assert.Contains(t, w.Body.String(), "read-only mode", tt.action)
+		} else {
+			assert.Equal(t, []string{tt.expectedQuery}, cortexRequests, tt.action)
+		}
+	}
+}
@@ -15,11 +15,19 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"flag"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -35,13 +43,72 @@ const cortexTenantHeaderName string = "X-Scope-OrgID"
 func main() {
 	var loglevel string
 	flag.StringVar(&loglevel, "loglevel", "info", "error|info|debug")
+	var logformat string
+	flag.StringVar(&logformat, "logformat", "text", "text|json")
 	var configAddress string
-	flag.StringVar(&configAddress, "config", "", "")
+	flag.StringVar(&configAddress, "config", "", "Public listen address, or CONFIG_LISTEN_ADDRESS env if unset")
 	var actionAddress string
-	flag.StringVar(&actionAddress, "action", "", "")
+	flag.StringVar(&actionAddress, "action", "", "Hasura action listen address, or ACTION_LISTEN_ADDRESS env if unset")
+
+	var shutdownTimeout time.Duration
+	flag.DurationVar(
+		&shutdownTimeout,
+		"shutdown-timeout",
+		30*time.Second,
+		"Time to wait for in-flight requests to complete after receiving SIGTERM",
+	)
+
+	var maxBodyBytes int64
+	flag.Int64Var(&maxBodyBytes, "max-body-bytes", 10*1024*1024, "Maximum request body size, or 0 for no limit")
+
+	var maxConcurrent int
+	flag.IntVar(&maxConcurrent, "max-concurrent-requests", 0, "Maximum config requests handled at once, or 0 for no limit")
+	var maxConcurrentWait time.Duration
+	flag.DurationVar(
+		&maxConcurrentWait,
+		"max-concurrent-wait",
+		time.Second,
+		"Time a request may wait for --max-concurrent-requests before getting a 503",
+	)
+
+	var readRateLimit float64
+	flag.Float64Var(&readRateLimit, "read-rate-limit", 0, "Per-tenant read requests/s, or 0 for no limit")
+	var readRateBurst int
+	flag.IntVar(&readRateBurst, "read-rate-burst", 20, "Per-tenant burst size for --read-rate-limit")
+	var writeRateLimit float64
+	flag.Float64Var(&writeRateLimit, "write-rate-limit", 0, "Per-tenant write requests/s, or 0 for no limit")
+	var writeRateBurst int
+	flag.IntVar(&writeRateBurst, "write-rate-burst", 5, "Per-tenant burst size for --write-rate-limit")
+
+	var corsAllowOrigins string
+	flag.StringVar(&corsAllowOrigins, "cors-allow-origin", "", "Comma-separated origins allowed via CORS, or '*'")
+	var corsAllowMethods string
+	flag.StringVar(&corsAllowMethods, "cors-allow-methods", "GET,POST,PUT,DELETE", "Comma-separated CORS methods")
+	var corsAllowHeaders string
+	flag.StringVar(
+		&corsAllowHeaders,
+		"cors-allow-headers",
+		"Authorization,Content-Type,X-Scope-OrgID",
+		"Comma-separated CORS request headers",
+	)
+
+	var tlsCertFile string
+	flag.StringVar(&tlsCertFile, "tls-cert", "", "TLS certificate file for the config listener, reloaded on SIGHUP")
+	var tlsKeyFile string
+	flag.StringVar(&tlsKeyFile, "tls-key", "", "TLS key file for the config listener, reloaded on SIGHUP")
+
+	var readOnly bool
+	flag.BoolVar(&readOnly, "read-only", false, "Reject config changes, both on the config port and via Hasura actions")
 
 	var disableAPIAuthentication bool
 	flag.BoolVar(&disableAPIAuthentication, "disable-api-authn", false, "")
+	var defaultTenant string
+	flag.StringVar(
+		&defaultTenant,
+		"default-tenant",
+		"",
+		"With --disable-api-authn, tenant to use when requests lack the X-Scope-OrgID header",
+	)
 
 	flag.Parse()
 
@@ -51,9 +118,27 @@ func main() {
 	}
 	log.SetLevel(level)
 
+	switch logformat {
+	case "text":
+		// logrus default
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		log.Fatalf("bad --logformat: %s", logformat)
+	}
+
+	// Allow configuring listen addresses via env, e.g. for container deployments. Flags take precedence.
 	if configAddress == "" {
-		log.Fatalf("missing required --config")
+		configAddress = os.Getenv("CONFIG_LISTEN_ADDRESS")
+	}
+	if actionAddress == "" {
+		actionAddress = os.Getenv("ACTION_LISTEN_ADDRESS")
 	}
+
+	if configAddress == "" {
+		log.Fatalf("missing required --config or CONFIG_LISTEN_ADDRESS")
+	}
+	log.Infof("version: %s", version)
 	log.Infof("config listen address: %s", configAddress)
 	log.Infof("action listen address: %s", actionAddress)
 
@@ -65,41 +150,155 @@ func main() {
 
 	if disableAPIAuthentication {
 		log.Infof("authentication disabled, use '%s' header in requests to specify tenant", authenticator.TestTenantHeader)
+		if defaultTenant != "" {
+			if err := authenticator.SetDefaultTestTenant(defaultTenant); err != nil {
+				log.Fatalf("bad --default-tenant: %s", err)
+			}
+			log.Infof("requests without '%s' header will use tenant %s", authenticator.TestTenantHeader, defaultTenant)
+		}
 	} else {
 		log.Info("authentication enabled")
+		if defaultTenant != "" {
+			log.Fatalf("--default-tenant requires --disable-api-authn")
+		}
 		authenticator.ReadConfigFromEnvOrCrash()
 	}
 
+	var servers []*http.Server
 	if actionAddress != "" {
-		actionSecret := os.Getenv("HASURA_ACTION_SECRET")
+		actionSecret := envSecret("HASURA_ACTION_SECRET")
 		if actionSecret == "" {
-			log.Fatalf("missing HASURA_ACTION_SECRET, required when -action is specified")
+			log.Fatalf("missing HASURA_ACTION_SECRET or HASURA_ACTION_SECRET_FILE, required when an action address is specified")
 		}
 
 		// Create separate access objects to avoid potential threading issues with config handler below
-		handler := NewHasuraHandler(alertmanagerURL, actionSecret)
-		// Not blocking on this one, but it will panic internally if there's a problem
-		go runActionHandler(handler, actionAddress)
+		handler := NewHasuraHandler(alertmanagerURL, actionSecret, readOnly)
+		actionRouter := buildActionHandler(handler, rulerURL, alertmanagerURL)
+		if maxBodyBytes > 0 {
+			actionRouter.Use(middleware.MaxBodyBytes(maxBodyBytes))
+		}
+		actionServer := &http.Server{Addr: actionAddress, Handler: actionRouter}
+		servers = append(servers, actionServer)
+		go runServer("action", actionServer)
 	}
 
-	configHandler := buildConfigHandler(rulerURL, alertmanagerURL, disableAPIAuthentication)
-	// Block on this one
-	log.Fatalf("terminated config listener: %v", http.ListenAndServe(configAddress, configHandler))
+	readLimiter := newRateLimiter("read", readRateLimit, readRateBurst)
+	writeLimiter := newRateLimiter("write", writeRateLimit, writeRateBurst)
+	configHandler := buildConfigHandler(
+		rulerURL,
+		alertmanagerURL,
+		disableAPIAuthentication,
+		readLimiter,
+		writeLimiter,
+	)
+	// Ahead of the limits below, so that browsers can read their 503 and 413 responses.
+	if origins := splitList(corsAllowOrigins); len(origins) > 0 {
+		log.Infof("CORS allowed origins: %s", strings.Join(origins, ", "))
+		configHandler.Use(middleware.CORS(origins, splitList(corsAllowMethods), splitList(corsAllowHeaders)))
+	}
+	if maxConcurrent > 0 {
+		log.Infof("max concurrent requests: %d", maxConcurrent)
+		configHandler.Use(middleware.MaxConcurrent(maxConcurrent, maxConcurrentWait))
+	}
+	if maxBodyBytes > 0 {
+		configHandler.Use(middleware.MaxBodyBytes(maxBodyBytes))
+	}
+	if readOnly {
+		log.Info("read-only mode, rejecting config changes")
+		configHandler.Use(middleware.ReadOnly())
+	}
+	configServer := &http.Server{Addr: configAddress, Handler: configHandler}
+	if tlsCertFile != "" || tlsKeyFile != "" {
+		if tlsCertFile == "" || tlsKeyFile == "" {
+			log.Fatalf("--tls-cert and --tls-key must be specified together")
+		}
+		reloader, err := newCertReloader(tlsCertFile, tlsKeyFile)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		go reloader.reloadOnSIGHUP()
+		configServer.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.getCertificate,
+		}
+		log.Infof("config listener TLS enabled with cert %s", tlsCertFile)
+	}
+	servers = append(servers, configServer)
+	go runServer("config", configServer)
+
+	// Block until we're told to stop, then let in-flight requests drain
+	waitForShutdown(shutdownTimeout, servers)
 }
 
-func runActionHandler(handler *HasuraHandler, actionAddress string) {
+func buildActionHandler(handler *HasuraHandler, rulerURL *url.URL, alertmanagerURL *url.URL) *mux.Router {
 	router := mux.NewRouter()
-	// Run metrics listener on this internal-only addresss instead of the main/ingress address.
+	// Run metrics and version listeners on this internal-only addresss instead of the main/ingress address.
 	router.Handle("/metrics", promhttp.Handler())
+	router.Handle("/version", versionHandler(rulerURL, alertmanagerURL))
 	router.HandleFunc("/", handler.handler)
+	router.Use(middleware.RequestID())
+	return router
+}
 
-	log.Fatalf("terminated action listener: %v", http.ListenAndServe(actionAddress, router))
+// Serves requests until the server fails or is shut down. Exits the process on failure.
+// Serves TLS if the server has a TLSConfig, whose GetCertificate supplies the certificate.
+func runServer(name string, server *http.Server) {
+	var err error
+	if server.TLSConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		log.Fatalf("terminated %s listener: %v", name, err)
+	}
+}
+
+// Waits for SIGTERM or SIGINT, then stops the servers from accepting new connections and waits up
+// to `timeout` for active requests to complete. This avoids dropping e.g. config writes mid-request.
+func waitForShutdown(timeout time.Duration, servers []*http.Server) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-sigs
+	log.Infof("received %s, shutting down with timeout %s", sig, timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	// Shut down concurrently, so that a slow listener doesn't eat into the others' share of the timeout.
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				log.Warnf("shutdown of listener %s did not complete cleanly: %v", server.Addr, err)
+			}
+		}(server)
+	}
+	wg.Wait()
+	log.Info("shutdown complete")
+}
+
+// Returns a per-tenant rate limiter, or nil if `perSecond` is zero. Idle tenants are periodically dropped.
+func newRateLimiter(name string, perSecond float64, burst int) *middleware.TenantRateLimiter {
+	if perSecond == 0 {
+		return nil
+	}
+	if perSecond < 0 || burst < 1 {
+		log.Fatalf("bad %s rate limit: rate must be >= 0 and burst must be >= 1", name)
+	}
+	log.Infof("%s rate limit: %v/s per tenant, burst %d", name, perSecond, burst)
+	limiter := middleware.NewTenantRateLimiter(perSecond, burst)
+	go limiter.RunCleanup()
+	return limiter
 }
 
 func buildConfigHandler(
 	rulerURL *url.URL,
 	alertmanagerURL *url.URL,
 	disableAPIAuthentication bool,
+	readLimiter *middleware.TenantRateLimiter,
+	writeLimiter *middleware.TenantRateLimiter,
 ) *mux.Router {
 	router := mux.NewRouter()
 
@@ -118,7 +317,7 @@ func buildConfigHandler(
 		cortexTenantHeaderName,
 		rulerURL,
 		disableAPIAuthentication,
-	).ReplacePaths(rulerPathReplacement)
+	).ReplacePaths(rulerPathReplacement).RateLimit(readLimiter, writeLimiter)
 	router.PathPrefix("/api/v1/ruler").HandlerFunc(rulerProxy.HandleWithProxy)
 	router.PathPrefix("/api/v1/rules").HandlerFunc(rulerProxy.HandleWithProxy)
 
@@ -140,14 +339,60 @@ func buildConfigHandler(
 		cortexTenantHeaderName,
 		alertmanagerURL,
 		disableAPIAuthentication,
-	).ReplacePaths(alertmanagerPathReplacement)
+	).ReplacePaths(alertmanagerPathReplacement).RateLimit(readLimiter, writeLimiter)
 	// We don't route /alertmanager for the Alertmanager UI since it isn't useful via curl.
 	// The Alertmanager UI can be viewed at '<tenant>.<cluster>.opstrace.io/alertmanager/'
 	router.PathPrefix("/api/v1/alerts").HandlerFunc(alertmanagerProxy.HandleWithProxy)
 	router.PathPrefix("/api/v1/multitenant_alertmanager").HandlerFunc(alertmanagerProxy.HandleWithProxy)
+
+	// Registered as a catch-all route rather than as the router's NotFoundHandler, so that the middleware
+	// below (and any added by the caller) also applies to 404 responses.
+	notFound := notFoundHandler(router)
+	router.MatcherFunc(matchAny).Handler(notFound)
+
+	// Metrics are served on the internal action port, see buildActionHandler.
+	router.Use(middleware.PrometheusMetricsByRoute("config_api"))
+	router.Use(middleware.RequestID())
+	router.Use(middleware.Gzip())
 	return router
 }
 
+func matchAny(*http.Request, *mux.RouteMatch) bool {
+	return true
+}
+
+// Returns a handler for unmatched paths, responding with a JSON 404 that lists the paths routed by
+// `router`. Must be called after all other routes have been registered.
+func notFoundHandler(router *mux.Router) http.Handler {
+	var paths []string
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if path, err := route.GetPathTemplate(); err == nil {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("failed to list config routes: %s", err)
+	}
+	body, err := json.Marshal(struct {
+		Error string   `json:"error"`
+		Paths []string `json:"paths"`
+	}{"not found", paths})
+	if err != nil {
+		log.Fatalf("failed to serialize 404 response: %s", err)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := middleware.Logger(r.Context())
+		logger.WithField("path", r.URL.Path).Debug("no route for request")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		if _, err := w.Write(body); err != nil {
+			logger.Errorf("writing response failed: %v", err)
+		}
+	})
+}
+
 func replacePathPrefix(url *url.URL, from string, to string) *string {
 	if strings.HasPrefix(url.Path, from) {
 		replaced := strings.Replace(url.Path, from, to, 1)
@@ -156,6 +401,31 @@ func replacePathPrefix(url *url.URL, from string, to string) *string {
 	return nil
 }
 
+// Reads a secret from the file named by `<envName>_FILE`, e.g. a mounted Kubernetes secret, falling back to
+// the value of `envName` itself. Surrounding whitespace is trimmed from the file contents.
+func envSecret(envName string) string {
+	path := os.Getenv(envName + "_FILE")
+	if path == "" {
+		return os.Getenv(envName)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatalf("failed to read %s_FILE: %s", envName, err)
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// Splits a comma-separated flag value, trimming whitespace and dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func envEndpointURL(envName string, defaultEndpoint *string) *url.URL {
 	endpoint := os.Getenv(envName)
 	if endpoint == "" {
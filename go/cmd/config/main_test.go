@@ -0,0 +1,80 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opstrace/opstrace/go/pkg/middleware"
+)
+
+func TestConfigHandler_notFound(t *testing.T) {
+	cortexURL, err := url.Parse("http://localhost")
+	assert.NoError(t, err)
+	router := buildConfigHandler(cortexURL, cortexURL, true, nil, nil)
+	router.Use(middleware.CORS([]string{"*"}, []string{"GET"}, []string{"Authorization"}))
+
+	r := httptest.NewRequest("GET", "/api/v2/rules", nil)
+	r.Header.Set("Origin", "https://ui.example")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	// Middleware applies to 404s like any other response
+	assert.NotEmpty(t, w.Header().Get(middleware.RequestIDHeader))
+	assert.Equal(t, "https://ui.example", w.Header().Get("Access-Control-Allow-Origin"))
+
+	var body struct {
+		Paths []string `json:"paths"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(
+		t,
+		[]string{"/api/v1/ruler", "/api/v1/rules", "/api/v1/alerts", "/api/v1/multitenant_alertmanager"},
+		body.Paths,
+	)
+}
+
+func TestEnvSecret(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	assert.NoError(t, ioutil.WriteFile(secretFile, []byte("from-file\n"), 0600))
+
+	t.Setenv("TEST_SECRET", "from-env")
+	assert.Equal(t, "from-env", envSecret("TEST_SECRET"))
+
+	// The file takes precedence, with its trailing newline trimmed
+	t.Setenv("TEST_SECRET_FILE", secretFile)
+	assert.Equal(t, "from-file", envSecret("TEST_SECRET"))
+
+	t.Setenv("TEST_SECRET_FILE", "")
+	t.Setenv("TEST_SECRET", "")
+	assert.Equal(t, "", envSecret("TEST_SECRET"))
+}
+
+func TestSplitList(t *testing.T) {
+	assert.Equal(t, []string{"GET", "POST"}, splitList(" GET, POST ,"))
+	assert.Equal(t, []string{"https://a.example", "https://b.example"}, splitList("https://a.example,,https://b.example"))
+	assert.Empty(t, splitList(""))
+	assert.Empty(t, splitList(" , "))
+}
@@ -0,0 +1,58 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"runtime"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/opstrace/opstrace/go/pkg/middleware"
+)
+
+// Set at build time via -ldflags "-X main.version=<revision>", see Makefile.
+var version = "unknown"
+
+type versionInfo struct {
+	Version                    string `json:"version"`
+	GoVersion                  string `json:"go_version"`
+	CortexRulerEndpoint        string `json:"cortex_ruler_endpoint"`
+	CortexAlertmanagerEndpoint string `json:"cortex_alertmanager_endpoint"`
+}
+
+// Returns a handler reporting the build version and the backend endpoints this instance talks to.
+// Any credentials in the endpoint URLs are redacted.
+func versionHandler(rulerURL *url.URL, alertmanagerURL *url.URL) http.HandlerFunc {
+	info := versionInfo{
+		Version:                    version,
+		GoVersion:                  runtime.Version(),
+		CortexRulerEndpoint:        rulerURL.Redacted(),
+		CortexAlertmanagerEndpoint: alertmanagerURL.Redacted(),
+	}
+	body, err := json.Marshal(info)
+	if err != nil {
+		log.Fatalf("failed to serialize version info: %v", err)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(body); err != nil {
+			middleware.Logger(r.Context()).Errorf("writing response failed: %v", err)
+		}
+	}
+}
@@ -17,6 +17,7 @@ package authenticator
 import (
 	"fmt"
 	"net/http"
+	"regexp"
 )
 
 // General note: authentication failure is an expected scenario, which is why
@@ -27,14 +28,35 @@ import (
 // lines up with the tenant HTTP header used by Cortex and Loki.
 const TestTenantHeader = "X-Scope-OrgID"
 
+// Tenant names accepted via TestTenantHeader. This matches the
+// tenant_name_validation constraint on the tenant table.
+var tenantNameRegexp = regexp.MustCompile(`^[a-z0-9]{2,63}$`)
+
+// Tenant used by GetTenantNameOr401 when authentication is disabled and the
+// TestTenantHeader is absent. When empty, the header is required.
+var defaultTestTenant string
+
+// SetDefaultTestTenant configures a tenant to assume for requests without the
+// TestTenantHeader, for single-tenant deployments running with authentication
+// disabled. An empty `tenantName` restores the default of requiring the
+// header. A present but invalid header is still rejected.
+func SetDefaultTestTenant(tenantName string) error {
+	if tenantName != "" && !tenantNameRegexp.MatchString(tenantName) {
+		return fmt.Errorf("invalid default tenant name %q: must match %s", tenantName, tenantNameRegexp.String())
+	}
+	defaultTestTenant = tenantName
+	return nil
+}
+
 /*
 Infer tenant identity (name) from request or context.
 
 Return 2-tuple (tenantName: string, ok: bool).
 
-Callers can rely on a 401 response to have been emitted when `ok` is `false`,
-and should terminate request processing. If `ok` is `false` do not use
-`tenantName`.
+Callers can rely on a 401 response to have been emitted when `ok` is `false`
+(or a 400 when authentication is disabled and the X-Scope-OrgID header holds
+an invalid tenant name), and should terminate request processing. If `ok` is
+`false` do not use `tenantName`.
 
 When `ok` is true, the request has been inspected and the returned `tenantName`
 can be used by the caller.
@@ -105,12 +127,25 @@ func GetTenantNameOr401(
 	}
 
 	// ONLY FOR TESTING: no single expected tenant, and authenticator
-	// is disabled: check for tenant in the X-Scope-OrgID header
+	// is disabled: check for tenant in the X-Scope-OrgID header, falling back
+	// to the default tenant if one is configured
 	tenantName := r.Header.Get(TestTenantHeader)
+	if tenantName == "" && defaultTestTenant != "" {
+		return defaultTestTenant, true
+	}
 	if tenantName == "" {
 		exit401(w, fmt.Sprintf("missing test %s header specifying tenant", TestTenantHeader))
 		return "", false
 	}
+	if !tenantNameRegexp.MatchString(tenantName) {
+		// Not an authentication failure: the client sent a malformed value.
+		exit400(w, fmt.Sprintf(
+			"invalid tenant name in %s header: must match %s",
+			TestTenantHeader,
+			tenantNameRegexp.String(),
+		))
+		return "", false
+	}
 	return tenantName, true
 }
 
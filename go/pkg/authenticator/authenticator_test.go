@@ -0,0 +1,85 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authenticator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTenantNameOr401_TestHeader(t *testing.T) {
+	tests := []struct {
+		header       string
+		expectedOK   bool
+		expectedCode int
+	}{
+		{"dev", true, http.StatusOK},
+		{"tenant42", true, http.StatusOK},
+		{"", false, http.StatusUnauthorized},
+		{"a", false, http.StatusBadRequest},
+		{"Dev", false, http.StatusBadRequest},
+		{"dev-tenant", false, http.StatusBadRequest},
+		{"dev\"}", false, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			r.Header.Set(TestTenantHeader, tt.header)
+		}
+		w := httptest.NewRecorder()
+
+		tenantName, ok := GetTenantNameOr401(w, r, nil, true)
+		assert.Equal(t, tt.expectedOK, ok, "header: %q", tt.header)
+		if ok {
+			assert.Equal(t, tt.header, tenantName)
+		} else {
+			assert.Equal(t, tt.expectedCode, w.Code, "header: %q", tt.header)
+		}
+	}
+}
+
+func TestGetTenantNameOr401_DefaultTenant(t *testing.T) {
+	assert.NoError(t, SetDefaultTestTenant("dev"))
+	defer func() { assert.NoError(t, SetDefaultTestTenant("")) }()
+
+	// Header absent: fall back to the default
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	tenantName, ok := GetTenantNameOr401(w, r, nil, true)
+	assert.True(t, ok)
+	assert.Equal(t, "dev", tenantName)
+
+	// Header present: takes precedence
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(TestTenantHeader, "other")
+	w = httptest.NewRecorder()
+	tenantName, ok = GetTenantNameOr401(w, r, nil, true)
+	assert.True(t, ok)
+	assert.Equal(t, "other", tenantName)
+
+	// Header invalid: still rejected
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(TestTenantHeader, "Other")
+	w = httptest.NewRecorder()
+	_, ok = GetTenantNameOr401(w, r, nil, true)
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	assert.Error(t, SetDefaultTestTenant("Dev"))
+}
@@ -91,3 +91,16 @@ func exit401(resp http.ResponseWriter, errmsg string) bool {
 	}
 	return false
 }
+
+// Write 400 response and return false. Like exit401, but for requests that
+// are malformed rather than unauthenticated.
+func exit400(resp http.ResponseWriter, errmsg string) bool {
+	resp.WriteHeader(http.StatusBadRequest)
+	log.Infof("emit 400. Err: %s", errmsg)
+
+	_, werr := resp.Write([]byte(errmsg))
+	if werr != nil {
+		log.Errorf("writing response failed: %v", werr)
+	}
+	return false
+}
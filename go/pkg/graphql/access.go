@@ -15,44 +15,286 @@
 package graphql
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"regexp"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// The timeout applied to GraphQL requests when WithTimeout has not been called.
+const defaultTimeout = 30 * time.Second
+
+// Spans are reported via the global TracerProvider, which is a no-op until a binary installs one.
+var tracer = otel.Tracer("github.com/opstrace/opstrace/go/pkg/graphql")
+
+// Extracts the operation name from e.g. "query GetIntegrations($tenant_id: uuid!) {".
+var operationNameRegexp = regexp.MustCompile(`^\s*(?:query|mutation|subscription)\s+(\w+)`)
+
+// Idle connections kept open to the GraphQL endpoint by default. The net/http default of 2 per host
+// results in constant reconnects when many requests are issued concurrently.
+const defaultMaxIdleConnsPerHost = 32
+
+// Shared by all GraphqlAccess instances unless WithTransport is used, so that they pool connections.
+var sharedTransport = NewTransport(defaultMaxIdleConnsPerHost)
+
+// The longest delay between retries, however many attempts were made.
+const maxRetryDelay = 30 * time.Second
+
+// The header carrying the secret when WithSecretHeader has not been called.
+const defaultSecretHeader = "x-hasura-admin-secret"
+
 type GraphqlAccess struct {
-	URL    string
-	client *http.Client
-	secret string
+	URL          string
+	client       *http.Client
+	secret       string
+	secretHeader string
+	secretScheme string
+	maxAttempts  int
+	baseDelay    time.Duration
 }
 
 func NewGraphqlAccess(url *url.URL, secret string) *GraphqlAccess {
 	return &GraphqlAccess{
 		url.String(),
-		&http.Client{},
+		&http.Client{Transport: sharedTransport, Timeout: defaultTimeout},
 		secret,
+		defaultSecretHeader,
+		"",
+		1,
+		0,
+	}
+}
+
+// NewTransport returns an HTTP transport for GraphQL clients, keeping up to `maxIdleConnsPerHost`
+// idle keep-alive connections to the endpoint. Pass the result to WithTransport to share a
+// differently sized pool across several GraphqlAccess instances.
+func NewTransport(maxIdleConnsPerHost int) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = maxIdleConnsPerHost * 4
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	transport.IdleConnTimeout = 90 * time.Second
+	return transport
+}
+
+// WithTransport replaces the shared default transport, e.g. with one from NewTransport.
+func (g *GraphqlAccess) WithTransport(transport http.RoundTripper) *GraphqlAccess {
+	g.client.Transport = transport
+	return g
+}
+
+// WithTimeout overrides the default timeout for each GraphQL request, covering connection setup
+// through reading the response body. A zero value disables the timeout.
+func (g *GraphqlAccess) WithTimeout(timeout time.Duration) *GraphqlAccess {
+	g.client.Timeout = timeout
+	return g
+}
+
+// WithSecretHeader overrides the header used to send the secret, for backends fronted by a gateway
+// that expects something other than Hasura's admin secret header. If `scheme` is non-empty, it is
+// prepended to the secret, e.g. "Authorization: Bearer <secret>".
+func (g *GraphqlAccess) WithSecretHeader(header string, scheme string) *GraphqlAccess {
+	g.secretHeader = header
+	g.secretScheme = scheme
+	return g
+}
+
+// WithRetries enables retrying requests that failed due to connection errors or 5xx responses,
+// for example while Hasura is restarting. Up to `maxAttempts` attempts are made in total, sleeping
+// for an exponentially increasing, jittered delay starting at `baseDelay` between attempts, up to 30s.
+// GraphQL-level errors and 4xx responses are never retried.
+func (g *GraphqlAccess) WithRetries(maxAttempts int, baseDelay time.Duration) *GraphqlAccess {
+	if maxAttempts < 1 {
+		maxAttempts = 1
 	}
+	g.maxAttempts = maxAttempts
+	g.baseDelay = baseDelay
+	return g
 }
 
 // Execute adds the secret onto the request, executes it, and deserializes the response into `result`.
-func (g *GraphqlAccess) Execute(req *http.Request, result interface{}) error {
+// The request is bound to `ctx`, allowing callers to cancel it while it is in flight.
+func (g *GraphqlAccess) Execute(ctx context.Context, req *http.Request, result interface{}) error {
+	operation, tenant := describeRequest(req)
+	ctx, span := tracer.Start(ctx, "graphql.Execute", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	span.SetAttributes(requestAttributes(req, operation, tenant)...)
+
+	err := g.execute(ctx, req, result)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		countError(err, operation)
+	}
+	return err
+}
+
+func (g *GraphqlAccess) execute(ctx context.Context, req *http.Request, result interface{}) error {
+	req = req.WithContext(ctx)
 	if g.secret != "" {
-		req.Header.Add("x-hasura-admin-secret", g.secret)
+		if g.secretScheme != "" {
+			req.Header.Add(g.secretHeader, fmt.Sprintf("%s %s", g.secretScheme, g.secret))
+		} else {
+			req.Header.Add(g.secretHeader, g.secret)
+		}
 	}
 
-	resp, err := execute(g.client, req)
+	resp, err := g.executeWithRetries(ctx, req)
 	if err != nil {
 		return err
 	}
 
 	if len(resp.Errors) != 0 {
-		return fmt.Errorf("query to %s failed: %s", req.URL.Path, resp.Error())
+		return newQueryError(req.URL.Path, resp.Errors)
 	}
 
 	if err := json.Unmarshal(resp.Data, result); err != nil {
-		return fmt.Errorf("failed to unmarshal response JSON '%s': %s", resp.Data, err)
+		return &categorizedError{
+			errorCategoryDecode,
+			fmt.Errorf("failed to unmarshal response JSON '%s': %w", resp.Data, err),
+		}
 	}
 
 	return nil
 }
+
+func (g *GraphqlAccess) executeWithRetries(ctx context.Context, req *http.Request) (*GraphQLResponse, error) {
+	for attempt := 1; ; attempt++ {
+		resp, retryable, err := g.executeOnce(req)
+		if err == nil || !retryable || attempt >= g.maxAttempts || !canResend(req) {
+			return resp, err
+		}
+
+		delay := backoffDelay(g.baseDelay, attempt)
+		log.Warnf(
+			"query to %s failed (attempt %d/%d), retrying in %s: %s",
+			req.URL.Path,
+			attempt,
+			g.maxAttempts,
+			delay,
+			err,
+		)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("query to %s cancelled while retrying: %w", req.URL.Path, err)
+		case <-time.After(delay):
+		}
+
+		// The body was consumed by the previous attempt, get a fresh copy.
+		if req.GetBody != nil {
+			body, berr := req.GetBody()
+			if berr != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// Returns whether the request can be sent again, i.e. it either has no body or the body can be re-read.
+func canResend(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// Sends the request once and decodes the GraphQL response envelope.
+// The returned bool reports whether a failure is transient and worth retrying.
+func (g *GraphqlAccess) executeOnce(req *http.Request) (*GraphQLResponse, bool, error) {
+	httpresp, err := g.client.Do(req)
+	if err != nil {
+		// Connection error or timeout, but give up if the caller cancelled.
+		return nil, req.Context().Err() == nil, newTransportError(err)
+	}
+	body, err := ioutil.ReadAll(httpresp.Body)
+	httpresp.Body.Close()
+	if err != nil {
+		return nil, true, newTransportError(err)
+	}
+	if httpresp.StatusCode >= 500 {
+		return nil, true, &categorizedError{
+			errorCategoryStatus,
+			fmt.Errorf("query to %s returned %d response: %s", req.URL.Path, httpresp.StatusCode, body),
+		}
+	}
+	resp, err := unmarshalGraphQLReponse(body)
+	if resp != nil && len(resp.Errors) > 0 {
+		// GraphQL-level errors are left in resp.Errors for the caller to inspect, whatever the status.
+		return resp, false, nil
+	}
+	if httpresp.StatusCode < 200 || httpresp.StatusCode > 299 {
+		// E.g. a 403 from a proxy in front of the server, which will fail the same way if retried.
+		return nil, false, &categorizedError{
+			errorCategoryStatus,
+			fmt.Errorf("query to %s returned %d response: %s", req.URL.Path, httpresp.StatusCode, body),
+		}
+	}
+	if resp != nil {
+		return resp, false, nil
+	}
+	return nil, false, &categorizedError{errorCategoryDecode, err}
+}
+
+// Returns baseDelay * 2^(attempt-1), with up to 50% random jitter added, and capped at maxRetryDelay.
+func backoffDelay(baseDelay time.Duration, attempt int) time.Duration {
+	if baseDelay <= 0 {
+		return 0
+	}
+	delay := baseDelay
+	// Double step by step rather than shifting, which would overflow for large attempt counts.
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// Returns span attributes for the request URL, and for the GraphQL operation name and tenant if known.
+func requestAttributes(req *http.Request, operation string, tenant string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.String("http.url", req.URL.String())}
+	if operation != "" {
+		attrs = append(attrs, attribute.String("graphql.operation", operation))
+	}
+	if tenant != "" {
+		attrs = append(attrs, attribute.String("tenant", tenant))
+	}
+	return attrs
+}
+
+// Returns the GraphQL operation name and tenant, when they can be read from the request payload.
+func describeRequest(req *http.Request) (string, string) {
+	if req.GetBody == nil {
+		return "", ""
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "", ""
+	}
+	defer body.Close()
+
+	var op struct {
+		Query     string `json:"query"`
+		Variables struct {
+			TenantID string `json:"tenant_id"`
+		} `json:"variables"`
+	}
+	if err := json.NewDecoder(body).Decode(&op); err != nil {
+		return "", ""
+	}
+	operation := ""
+	if match := operationNameRegexp.FindStringSubmatch(op.Query); match != nil {
+		operation = match[1]
+	}
+	return operation, op.Variables.TenantID
+}
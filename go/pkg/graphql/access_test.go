@@ -0,0 +1,214 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphql
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testResponse struct {
+	code int
+	body string
+}
+
+const integrationsResponse = `{"data": {"integration": [{"name": "foo"}]}}`
+
+// Starts a GraphQL server that replies with each of `responses` in turn, repeating the last one.
+// Returns the access object along with the request bodies received so far.
+func newTestAccess(t *testing.T, responses ...testResponse) (*GraphqlAccess, *[]string, func()) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, string(body))
+
+		resp := responses[len(responses)-1]
+		if len(bodies) <= len(responses) {
+			resp = responses[len(bodies)-1]
+		}
+		w.WriteHeader(resp.code)
+		_, _ = w.Write([]byte(resp.body))
+	}))
+
+	serverURL, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+	return NewGraphqlAccess(serverURL, "secret"), &bodies, server.Close
+}
+
+func newTestRequest(t *testing.T, g *GraphqlAccess) *http.Request {
+	req, err := NewGetIntegrationsRequest(g.URL, &GetIntegrationsVariables{TenantId: "dev"})
+	assert.NoError(t, err)
+	return req.Request
+}
+
+func TestExecute_retries5xx(t *testing.T) {
+	g, bodies, closer := newTestAccess(
+		t,
+		testResponse{http.StatusServiceUnavailable, "restarting"},
+		testResponse{http.StatusBadGateway, "restarting"},
+		testResponse{http.StatusOK, integrationsResponse},
+	)
+	defer closer()
+	g.WithRetries(3, time.Millisecond)
+
+	var result GetIntegrationsResponse
+	err := g.Execute(context.Background(), newTestRequest(t, g), &result)
+	assert.NoError(t, err)
+	assert.Len(t, result.Integration, 1)
+
+	// Each attempt sent the full request body
+	assert.Len(t, *bodies, 3)
+	assert.Contains(t, (*bodies)[0], "GetIntegrations")
+	for _, body := range *bodies {
+		assert.Equal(t, (*bodies)[0], body)
+	}
+}
+
+func TestExecute_retriesExhausted(t *testing.T) {
+	g, bodies, closer := newTestAccess(t, testResponse{http.StatusServiceUnavailable, "restarting"})
+	defer closer()
+	g.WithRetries(2, time.Millisecond)
+
+	var result GetIntegrationsResponse
+	err := g.Execute(context.Background(), newTestRequest(t, g), &result)
+	assert.Error(t, err)
+	assert.Len(t, *bodies, 2)
+}
+
+func TestExecute_noRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		response testResponse
+	}{
+		{"4xx", testResponse{http.StatusBadRequest, "bad request"}},
+		{"graphql error", testResponse{http.StatusOK, `{"errors": [{"message": "field not found"}]}`}},
+	}
+
+	for _, tt := range tests {
+		g, bodies, closer := newTestAccess(t, tt.response, testResponse{http.StatusOK, integrationsResponse})
+		g.WithRetries(3, time.Millisecond)
+
+		var result GetIntegrationsResponse
+		err := g.Execute(context.Background(), newTestRequest(t, g), &result)
+		assert.Error(t, err, tt.name)
+		assert.Len(t, *bodies, 1, tt.name)
+		closer()
+	}
+}
+
+func TestExecute_statusWithoutGraphQLErrors(t *testing.T) {
+	g, bodies, closer := newTestAccess(t, testResponse{http.StatusForbidden, `{"message": "forbidden"}`})
+	defer closer()
+	g.WithRetries(3, time.Millisecond)
+
+	var result GetIntegrationsResponse
+	err := g.Execute(context.Background(), newTestRequest(t, g), &result)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "403")
+	assert.Equal(t, errorCategoryStatus, errorCategory(err))
+	assert.Len(t, *bodies, 1)
+}
+
+func TestExecute_cancelledWhileRetrying(t *testing.T) {
+	g, bodies, closer := newTestAccess(t, testResponse{http.StatusServiceUnavailable, "restarting"})
+	defer closer()
+	g.WithRetries(3, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	var result GetIntegrationsResponse
+	err := g.Execute(ctx, newTestRequest(t, g), &result)
+	assert.Error(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Minute))
+	assert.Len(t, *bodies, 1)
+}
+
+func TestExecute_cancelled(t *testing.T) {
+	g, bodies, closer := newTestAccess(t, testResponse{http.StatusOK, integrationsResponse})
+	defer closer()
+	g.WithRetries(3, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var result GetIntegrationsResponse
+	err := g.Execute(ctx, newTestRequest(t, g), &result)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Empty(t, *bodies)
+}
+
+func TestBackoffDelay(t *testing.T) {
+	for attempt := 1; attempt <= 3; attempt++ {
+		base := time.Second << uint(attempt-1)
+		delay := backoffDelay(time.Second, attempt)
+		assert.GreaterOrEqual(t, int64(delay), int64(base), "attempt %d", attempt)
+		assert.LessOrEqual(t, int64(delay), int64(base+base/2), "attempt %d", attempt)
+	}
+
+	// Capped rather than overflowing
+	assert.Equal(t, maxRetryDelay, backoffDelay(time.Second, 64))
+	assert.Equal(t, maxRetryDelay, backoffDelay(time.Second, 1000))
+	assert.Equal(t, time.Duration(0), backoffDelay(0, 5))
+}
+
+func TestExecute_secretHeader(t *testing.T) {
+	tests := []struct {
+		name          string
+		header        string
+		scheme        string
+		expectedName  string
+		expectedValue string
+	}{
+		{"default", "", "", "X-Hasura-Admin-Secret", "secret"},
+		{"custom header", "X-Api-Key", "", "X-Api-Key", "secret"},
+		{"with scheme", "Authorization", "Bearer", "Authorization", "Bearer secret"},
+	}
+
+	for _, tt := range tests {
+		var got http.Header
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Clone()
+			_, _ = w.Write([]byte(integrationsResponse))
+		}))
+		serverURL, err := url.Parse(server.URL)
+		assert.NoError(t, err)
+
+		g := NewGraphqlAccess(serverURL, "secret")
+		if tt.header != "" {
+			g.WithSecretHeader(tt.header, tt.scheme)
+		}
+		var result GetIntegrationsResponse
+		assert.NoError(t, g.Execute(context.Background(), newTestRequest(t, g), &result), tt.name)
+		assert.Equal(t, tt.expectedValue, got.Get(tt.expectedName), tt.name)
+		if tt.header != "" {
+			assert.Empty(t, got.Get(defaultSecretHeader), tt.name)
+		}
+		server.Close()
+	}
+}
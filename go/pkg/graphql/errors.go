@@ -0,0 +1,93 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Error codes reported by Hasura in the `extensions.code` field of a GraphQL error.
+// See https://hasura.io/docs/latest/graphql/core/api-reference/graphql-api/index.html
+const (
+	ConstraintViolationCode = "constraint-violation"
+	ValidationFailedCode    = "validation-failed"
+	NotExistsCode           = "not-exists"
+	PermissionErrorCode     = "permission-error"
+	AccessDeniedCode        = "access-denied"
+)
+
+// QueryErrorDetail is a single entry of the `errors` array in a GraphQL response.
+type QueryErrorDetail struct {
+	Message string
+	// The `extensions.code` value, or empty if the server did not provide one.
+	Code string
+}
+
+// QueryError is returned by GraphqlAccess.Execute when the server responded with GraphQL-level errors.
+// Callers can use errors.As to inspect the codes and map known conditions to HTTP statuses.
+type QueryError struct {
+	Path    string
+	Details []QueryErrorDetail
+}
+
+func newQueryError(path string, errs []GraphQLError) *QueryError {
+	details := make([]QueryErrorDetail, 0, len(errs))
+	for _, e := range errs {
+		detail := QueryErrorDetail{}
+		if message, ok := e["message"].(string); ok {
+			detail.Message = message
+		} else {
+			detail.Message = e.Error()
+		}
+		if extensions, ok := e["extensions"].(map[string]interface{}); ok {
+			if code, ok := extensions["code"].(string); ok {
+				detail.Code = code
+			}
+		}
+		details = append(details, detail)
+	}
+	return &QueryError{path, details}
+}
+
+func (e *QueryError) Error() string {
+	msgs := make([]string, 0, len(e.Details))
+	for _, d := range e.Details {
+		if d.Code != "" {
+			msgs = append(msgs, fmt.Sprintf("%s (%s)", d.Message, d.Code))
+		} else {
+			msgs = append(msgs, d.Message)
+		}
+	}
+	return fmt.Sprintf("query to %s failed: %s", e.Path, strings.Join(msgs, "; "))
+}
+
+// HasCode returns whether any of the reported errors carry the provided `extensions.code`.
+func (e *QueryError) HasCode(code string) bool {
+	for _, d := range e.Details {
+		if d.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// IsConstraintViolation returns whether `err` is a QueryError caused by a database constraint,
+// for example a unique key conflict on insert.
+func IsConstraintViolation(err error) bool {
+	var qerr *QueryError
+	return errors.As(err, &qerr) && qerr.HasCode(ConstraintViolationCode)
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphql
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewQueryError(t *testing.T) {
+	tests := []struct {
+		name            string
+		errs            []GraphQLError
+		expectedDetails []QueryErrorDetail
+		expectedError   string
+		constraint      bool
+	}{
+		{
+			"no extensions",
+			[]GraphQLError{{"message": "boom"}},
+			[]QueryErrorDetail{{Message: "boom"}},
+			"query to /v1/graphql failed: boom",
+			false,
+		},
+		{
+			"non-string code",
+			[]GraphQLError{{"message": "boom", "extensions": map[string]interface{}{"code": 42}}},
+			[]QueryErrorDetail{{Message: "boom"}},
+			"query to /v1/graphql failed: boom",
+			false,
+		},
+		{
+			"no message",
+			[]GraphQLError{{"extensions": map[string]interface{}{"code": NotExistsCode}}},
+			[]QueryErrorDetail{{Message: "graphql: map[extensions:map[code:not-exists]]", Code: NotExistsCode}},
+			"query to /v1/graphql failed: graphql: map[extensions:map[code:not-exists]] (not-exists)",
+			false,
+		},
+		{
+			"several errors",
+			[]GraphQLError{
+				{"message": "field not found", "extensions": map[string]interface{}{"code": ValidationFailedCode}},
+				{"message": "duplicate key", "extensions": map[string]interface{}{"code": ConstraintViolationCode}},
+			},
+			[]QueryErrorDetail{
+				{Message: "field not found", Code: ValidationFailedCode},
+				{Message: "duplicate key", Code: ConstraintViolationCode},
+			},
+			"query to /v1/graphql failed: field not found (validation-failed); duplicate key (constraint-violation)",
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		qerr := newQueryError("/v1/graphql", tt.errs)
+		assert.Equal(t, tt.expectedDetails, qerr.Details, tt.name)
+		assert.Equal(t, tt.expectedError, qerr.Error(), tt.name)
+		assert.Equal(t, tt.constraint, IsConstraintViolation(qerr), tt.name)
+		// Also found when wrapped
+		assert.Equal(t, tt.constraint, IsConstraintViolation(fmt.Errorf("insert failed: %w", qerr)), tt.name)
+	}
+
+	assert.False(t, IsConstraintViolation(errors.New("constraint-violation")))
+	assert.False(t, IsConstraintViolation(nil))
+}
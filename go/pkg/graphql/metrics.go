@@ -0,0 +1,89 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphql
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Values of the `category` label on the client errors metric.
+const (
+	errorCategoryConnection = "connection"
+	errorCategoryTimeout    = "timeout"
+	errorCategoryCancelled  = "cancelled"
+	errorCategoryStatus     = "http_status"
+	errorCategoryGraphQL    = "graphql"
+	errorCategoryDecode     = "decode"
+	errorCategoryOther      = "other"
+)
+
+// Counts failed GraphqlAccess.Execute calls, so that it's visible why calls to Hasura are failing.
+// Retried attempts that eventually succeed are not counted.
+var clientErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "opstrace",
+	Name:      "graphql_client_errors_total",
+	Help:      "Total number of failed GraphQL requests, by failure category and operation name.",
+}, []string{"category", "operation"})
+
+// Tags an error with its category for the client errors metric.
+type categorizedError struct {
+	category string
+	err      error
+}
+
+func (e *categorizedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *categorizedError) Unwrap() error {
+	return e.err
+}
+
+// Categorizes an error from sending the request or reading the response body.
+func newTransportError(err error) *categorizedError {
+	var nerr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return &categorizedError{errorCategoryCancelled, err}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &nerr) && nerr.Timeout():
+		return &categorizedError{errorCategoryTimeout, err}
+	default:
+		return &categorizedError{errorCategoryConnection, err}
+	}
+}
+
+func errorCategory(err error) string {
+	var qerr *QueryError
+	if errors.As(err, &qerr) {
+		return errorCategoryGraphQL
+	}
+	var cerr *categorizedError
+	if errors.As(err, &cerr) {
+		return cerr.category
+	}
+	return errorCategoryOther
+}
+
+func countError(err error, operation string) {
+	if operation == "" {
+		operation = "unknown"
+	}
+	clientErrors.WithLabelValues(errorCategory(err), operation).Inc()
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestErrorCategory(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"graphql", newQueryError("/v1/graphql", []GraphQLError{{"message": "boom"}}), errorCategoryGraphQL},
+		{"connection", newTransportError(errors.New("connection refused")), errorCategoryConnection},
+		{"net timeout", newTransportError(&url.Error{Op: "Post", URL: "/", Err: timeoutError{}}), errorCategoryTimeout},
+		{"deadline", newTransportError(context.DeadlineExceeded), errorCategoryTimeout},
+		{"cancelled", newTransportError(fmt.Errorf("post: %w", context.Canceled)), errorCategoryCancelled},
+		{"status", &categorizedError{errorCategoryStatus, errors.New("503")}, errorCategoryStatus},
+		{
+			"wrapped",
+			fmt.Errorf("cancelled while retrying: %w", &categorizedError{errorCategoryStatus, errors.New("503")}),
+			errorCategoryStatus,
+		},
+		{"other", errors.New("something else"), errorCategoryOther},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, errorCategory(tt.err), tt.name)
+	}
+}
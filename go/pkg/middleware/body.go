@@ -0,0 +1,64 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// MaxBodyBytes limits request bodies to `limit` bytes. Requests whose Content-Length is already over the
+// limit are rejected with a 413 up front. Otherwise the body is streamed to the wrapped handler as before,
+// and reads fail once more than `limit` bytes have been read, e.g. for chunked uploads without a
+// Content-Length.
+//
+// The body is deliberately not buffered here: this runs before authentication, so buffering would let
+// any client make the server hold `limit` bytes per open request.
+func MaxBodyBytes(limit int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.ContentLength > limit {
+				exit413(w, limit)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Returns whether `err` came from reading past the limit of a body wrapped by MaxBodyBytes.
+// http.MaxBytesReader doesn't return a distinct error type until Go 1.19.
+func isBodyTooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "http: request body too large")
+}
+
+func exit413(w http.ResponseWriter, limit int64) {
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	_, werr := w.Write([]byte(fmt.Sprintf("request body exceeds limit of %d bytes", limit)))
+	if werr != nil {
+		log.Errorf("writing response failed: %v", werr)
+	}
+}
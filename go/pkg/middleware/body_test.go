@@ -0,0 +1,97 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMaxBodyBytes(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		chunked       bool
+		expectedCode  int
+		expectedReads string
+	}{
+		{"under limit", "hello", false, http.StatusOK, "hello"},
+		{"at limit", "0123456789", false, http.StatusOK, "0123456789"},
+		{"over limit", "0123456789a", false, http.StatusRequestEntityTooLarge, ""},
+		{"over limit without content length", "0123456789a", true, http.StatusRequestEntityTooLarge, ""},
+	}
+
+	for _, tt := range tests {
+		var got string
+		router := mux.NewRouter()
+		router.Use(MaxBodyBytes(10))
+		router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			if isBodyTooLarge(err) {
+				exit413(w, 10)
+				return
+			}
+			got = string(body)
+		})
+
+		r := httptest.NewRequest("POST", "/test", strings.NewReader(tt.body))
+		if tt.chunked {
+			r.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		if w.Code != tt.expectedCode {
+			t.Errorf("%s: want status %d got %d", tt.name, tt.expectedCode, w.Code)
+		}
+		if got != tt.expectedReads {
+			t.Errorf("%s: want handler to read %q got %q", tt.name, tt.expectedReads, got)
+		}
+	}
+}
+
+func TestMaxBodyBytes_proxy(t *testing.T) {
+	upstreamURL, upstreamClose := createUpstreamTenantEcho(tenantName, t)
+	defer upstreamClose()
+
+	disableAPIAuth := true
+	rp := NewReverseProxyFixedTenant(tenantName, tenantHeaderName, upstreamURL, disableAPIAuth)
+	router := mux.NewRouter()
+	router.Use(MaxBodyBytes(10))
+	router.PathPrefix("/").HandlerFunc(rp.HandleWithProxy)
+
+	// Within the limit: streamed through to the backend
+	r := httptest.NewRequest("POST", "/test", strings.NewReader("hello"))
+	r.ContentLength = -1
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("want status %d got %d", http.StatusOK, w.Code)
+	}
+
+	// Over the limit without a content length: the limit is hit while streaming to the backend
+	r = httptest.NewRequest("POST", "/test", strings.NewReader(strings.Repeat("a", 100)))
+	r.ContentLength = -1
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("want status %d got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
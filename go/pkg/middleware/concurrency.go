@@ -0,0 +1,67 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// MaxConcurrent bounds the number of requests being handled at once to `limit`. Requests beyond the
+// limit wait up to `wait` for a slot before being rejected with a 503. A zero `wait` rejects them
+// immediately.
+//
+// The returned middleware may be installed on several routers to share a single limit across them.
+func MaxConcurrent(limit int, wait time.Duration) mux.MiddlewareFunc {
+	slots := make(chan struct{}, limit)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !acquire(r, slots, wait) {
+				Logger(r.Context()).WithField("path", r.URL.Path).Warnf("rejecting request: %d requests in flight", limit)
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "too many concurrent requests, try again later", http.StatusServiceUnavailable)
+				return
+			}
+			defer func() { <-slots }()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Takes a slot, waiting up to `wait` for one to free up. Gives up early if the client goes away.
+func acquire(r *http.Request, slots chan struct{}, wait time.Duration) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
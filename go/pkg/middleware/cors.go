@@ -0,0 +1,64 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// CORS adds CORS headers to responses for requests from one of `allowedOrigins`, which may include
+// "*" to allow any origin. Requests from other origins, or without an Origin header, are passed
+// through unchanged.
+//
+// Preflight OPTIONS requests from an allowed origin are answered directly with a 204, listing
+// `allowedMethods` and `allowedHeaders`. They are not passed to the wrapped handler, since browsers
+// do not send credentials with preflight requests and they would otherwise be rejected with a 401.
+func CORS(allowedOrigins []string, allowedMethods []string, allowedHeaders []string) mux.MiddlewareFunc {
+	origins := make(map[string]struct{}, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		origins[origin] = struct{}{}
+	}
+	_, anyOrigin := origins["*"]
+	methods := strings.Join(allowedMethods, ", ")
+	headers := strings.Join(allowedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// Responses differ depending on the origin, so caches must not share them across origins.
+			w.Header().Add("Vary", "Origin")
+			if _, ok := origins[origin]; !ok && !anyOrigin {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
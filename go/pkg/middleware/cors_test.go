@@ -0,0 +1,68 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		origin         string
+		preflight      bool
+		expectedCode   int
+		expectedOrigin string
+		expectedMethod string
+	}{
+		{"no origin", "GET", "", false, http.StatusOK, "", ""},
+		{"unknown origin", "GET", "https://evil.example", false, http.StatusOK, "", ""},
+		{"allowed origin", "GET", "https://ui.example", false, http.StatusOK, "https://ui.example", ""},
+		{"preflight", "OPTIONS", "https://ui.example", true, http.StatusNoContent, "https://ui.example", "GET, POST"},
+		{"preflight unknown origin", "OPTIONS", "https://evil.example", true, http.StatusOK, "", ""},
+		{"options without preflight", "OPTIONS", "https://ui.example", false, http.StatusOK, "https://ui.example", ""},
+	}
+
+	for _, tt := range tests {
+		router := mux.NewRouter()
+		router.Use(CORS([]string{"https://ui.example"}, []string{"GET", "POST"}, []string{"Authorization"}))
+		router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+		r := httptest.NewRequest(tt.method, "/api/v1/rules", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if tt.preflight {
+			r.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		if w.Code != tt.expectedCode {
+			t.Errorf("%s: want status %d got %d", tt.name, tt.expectedCode, w.Code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedOrigin {
+			t.Errorf("%s: want allowed origin %q got %q", tt.name, tt.expectedOrigin, got)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Methods"); got != tt.expectedMethod {
+			t.Errorf("%s: want allowed methods %q got %q", tt.name, tt.expectedMethod, got)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// Gzip transparently handles gzip compression for the wrapped handler. Request bodies sent with
+// "Content-Encoding: gzip" are decompressed before reaching the handler. Responses are compressed
+// when the client sent "Accept-Encoding: gzip", unless the handler already set a Content-Encoding.
+//
+// The Accept-Encoding header is removed from the request passed to the handler, so that e.g. a
+// reverse proxy fetches an uncompressed response from its backend which is then compressed here.
+func Gzip() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+				gzr, err := gzip.NewReader(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					_, werr := w.Write([]byte("invalid gzip request body: " + err.Error()))
+					if werr != nil {
+						log.Errorf("writing response failed: %v", werr)
+					}
+					return
+				}
+				defer gzr.Close()
+				r.Body = gzr
+				r.ContentLength = -1
+				r.Header.Del("Content-Encoding")
+				r.Header.Del("Content-Length")
+			}
+
+			if !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			r.Header.Del("Accept-Encoding")
+
+			gzw := &gzipResponseWriter{ResponseWriter: w, head: r.Method == http.MethodHead}
+			defer gzw.Close()
+			next.ServeHTTP(gzw, r)
+		})
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, encoding := range strings.Split(value, ",") {
+			// Ignore any quality value, e.g. "gzip;q=0.8"
+			encoding = strings.TrimSpace(strings.SplitN(encoding, ";", 2)[0])
+			if strings.EqualFold(encoding, "gzip") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Holds back the status until the first non-empty Write, so that responses without a body are not
+// marked as gzip-encoded.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	head        bool
+	code        int
+	wroteHeader bool
+	gz          *gzip.Writer
+}
+
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if g.wroteHeader || g.code != 0 {
+		return
+	}
+	g.code = code
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !g.wroteHeader {
+		if len(b) == 0 {
+			return 0, nil
+		}
+		g.sendHeader(b)
+	}
+	if g.gz == nil {
+		return g.ResponseWriter.Write(b)
+	}
+	return g.gz.Write(b)
+}
+
+// Sends the held back status and headers, compressing the response if `body` (the first chunk of the
+// response) is non-empty. Since net/http can't detect the Content-Type of compressed content, it is
+// detected here from the uncompressed bytes.
+func (g *gzipResponseWriter) sendHeader(body []byte) {
+	g.wroteHeader = true
+	code := g.code
+	if code == 0 {
+		code = http.StatusOK
+	}
+
+	h := g.Header()
+	h.Add("Vary", "Accept-Encoding")
+	if len(body) != 0 && !g.head && code != http.StatusNoContent && code != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" {
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(body))
+		}
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(code)
+}
+
+// Flush sends any buffered compressed data, e.g. for streamed responses via a reverse proxy.
+// Does nothing until the header has been sent, since the status is held back until there's a body.
+func (g *gzipResponseWriter) Flush() {
+	if !g.wroteHeader {
+		return
+	}
+	if g.gz != nil {
+		if err := g.gz.Flush(); err != nil {
+			log.Errorf("flushing gzip response failed: %v", err)
+		}
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close sends the status if there was no body, or otherwise writes the gzip footer if the response
+// was compressed.
+func (g *gzipResponseWriter) Close() {
+	if !g.wroteHeader && g.code != 0 {
+		g.sendHeader(nil)
+	}
+	if g.gz != nil {
+		if err := g.gz.Close(); err != nil {
+			log.Errorf("closing gzip response failed: %v", err)
+		}
+	}
+}
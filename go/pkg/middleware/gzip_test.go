@@ -0,0 +1,150 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func newGzipTestRouter(handler http.HandlerFunc) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(Gzip())
+	router.PathPrefix("/").HandlerFunc(handler)
+	return router
+}
+
+func TestGzipRequestBody(t *testing.T) {
+	var got string
+	router := newGzipTestRouter(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		got = string(body)
+	})
+
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	_, _ = gzw.Write([]byte("some: yaml"))
+	gzw.Close()
+
+	r := httptest.NewRequest("POST", "/test", &buf)
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("want 200 got %d", w.Code)
+	}
+	if got != "some: yaml" {
+		t.Errorf("want decompressed body, got %q", got)
+	}
+
+	// Not actually gzip
+	r = httptest.NewRequest("POST", "/test", strings.NewReader("some: yaml"))
+	r.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("want 400 got %d", w.Code)
+	}
+}
+
+func TestGzipResponse(t *testing.T) {
+	router := newGzipTestRouter(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "" {
+			t.Errorf("expected Accept-Encoding to be removed before reaching handler")
+		}
+		_, _ = w.Write([]byte("some: yaml"))
+	})
+
+	r := httptest.NewRequest("GET", "/test", nil)
+	r.Header.Set("Accept-Encoding", "deflate, gzip;q=0.8")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("want gzip Content-Encoding, got %q", w.Header().Get("Content-Encoding"))
+	}
+	gzr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("response is not gzip: %v", err)
+	}
+	body, _ := ioutil.ReadAll(gzr)
+	if string(body) != "some: yaml" {
+		t.Errorf("want decompressed response 'some: yaml', got %q", body)
+	}
+
+	// Client doesn't accept gzip
+	r = httptest.NewRequest("GET", "/test", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("want no Content-Encoding, got %q", w.Header().Get("Content-Encoding"))
+	}
+	if w.Body.String() != "some: yaml" {
+		t.Errorf("want plain response, got %q", w.Body.String())
+	}
+}
+
+func TestGzipResponse_noBody(t *testing.T) {
+	router := newGzipTestRouter(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	r := httptest.NewRequest("POST", "/test", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("want 201 got %d", w.Code)
+	}
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("want no Content-Encoding for empty response, got %q", w.Header().Get("Content-Encoding"))
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("want empty response, got %q", w.Body.String())
+	}
+}
+
+func TestGzipResponse_contentType(t *testing.T) {
+	router := newGzipTestRouter(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte("authentication token missing"))
+	})
+
+	r := httptest.NewRequest("GET", "/test", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("want 401 got %d", w.Code)
+	}
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("want gzip Content-Encoding, got %q", w.Header().Get("Content-Encoding"))
+	}
+	if w.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Errorf("want Content-Type detected from uncompressed body, got %q", w.Header().Get("Content-Type"))
+	}
+}
@@ -51,14 +51,33 @@ func (rrw *recordResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return conn, rw, err
 }
 
+// PrometheusMetrics records request metrics labeled by the request path, e.g. "api_v1_query_range" for
+// /api/v1/query_range. Only suitable when the paths served are a fixed set, as with the cortex and loki
+// APIs, since each distinct path results in new series.
 func PrometheusMetrics(name string) mux.MiddlewareFunc {
+	return prometheusMetrics(name, pathLabel)
+}
+
+// PrometheusMetricsByRoute records request metrics labeled by the path template of the matched route,
+// e.g. "api_v1_rules" for any request under a PathPrefix("/api/v1/rules") route. Use this when paths
+// contain arbitrary user-chosen names, which would otherwise result in an unbounded number of series.
+func PrometheusMetricsByRoute(name string) mux.MiddlewareFunc {
+	return prometheusMetrics(name, routeLabel)
+}
+
+func prometheusMetrics(name string, label func(*http.Request) string) mux.MiddlewareFunc {
 	requestDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: name,
 		Name:      "request_duration_seconds",
 		Help:      "Time (in seconds) spent serving HTTP requests.",
 		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 25, 50, 100},
 	}, []string{"method", "route", "status_code"})
-	prometheus.MustRegister(requestDuration)
+	requestsTotal := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: name,
+		Name:      "requests_total",
+		Help:      "Total number of HTTP requests served.",
+	}, []string{"method", "route", "status_code"})
+	prometheus.MustRegister(requestDuration, requestsTotal)
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -67,13 +86,37 @@ func PrometheusMetrics(name string) mux.MiddlewareFunc {
 			rw := newRecordResponseWriter(w)
 			next.ServeHTTP(rw, r) // call original
 
-			status := strconv.Itoa(rw.statusCode)
+			statusCode := rw.statusCode
+			if statusCode == 0 {
+				// Handler wrote a body (or nothing) without calling WriteHeader
+				statusCode = http.StatusOK
+			}
+			status := strconv.Itoa(statusCode)
 			took := time.Since(start)
 			method := r.Method
-			// this aligns with the way cortex and loki do it
-			route := strings.ReplaceAll(strings.Replace(r.URL.Path, "/", "", 1), "/", "_")
+			route := label(r)
 
 			requestDuration.WithLabelValues(method, route, status).Observe(took.Seconds())
+			requestsTotal.WithLabelValues(method, route, status).Inc()
 		})
 	}
 }
+
+// Returns the request path, formatted the way cortex and loki do it.
+func pathLabel(r *http.Request) string {
+	return strings.ReplaceAll(strings.Replace(r.URL.Path, "/", "", 1), "/", "_")
+}
+
+// Returns the path template of the matched route, formatted like pathLabel.
+func routeLabel(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "unmatched"
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		// No path, e.g. a catch-all route for returning 404s
+		return "unmatched"
+	}
+	return strings.ReplaceAll(strings.Replace(template, "/", "", 1), "/", "_")
+}
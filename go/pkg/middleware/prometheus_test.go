@@ -152,16 +152,96 @@ func TestPrometheusMetrics(t *testing.T) {
 		t.Errorf("got %v", err)
 	}
 
-	fail := true
-	metricName := "test_prefix_request_duration_seconds"
+	for _, metricName := range []string{
+		"test_prefix_request_duration_seconds",
+		"test_prefix_requests_total",
+	} {
+		fail := true
+		for _, m := range metrics {
+			if m.Name != nil && *m.Name == metricName {
+				fail = false
+			}
+		}
+
+		if fail {
+			t.Errorf("expected %s to be in the list of gathered metrics", metricName)
+		}
+	}
+}
+
+// With PrometheusMetricsByRoute, requests to PathPrefix routes are labeled by the route, not by the full
+// request path.
+func TestPrometheusMetrics_routeLabel(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(PrometheusMetricsByRoute("test_route_prefix"))
+	router.PathPrefix("/api/v1/rules").HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		// nothing to do here
+	})
 
+	for _, path := range []string{"/api/v1/rules/ns1/group1", "/api/v1/rules/ns2/group2"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Errorf("got %v", err)
+	}
 	for _, m := range metrics {
-		if m.Name != nil && *m.Name == metricName {
-			fail = false
+		if m.GetName() != "test_route_prefix_requests_total" {
+			continue
+		}
+		if len(m.Metric) != 1 {
+			t.Fatalf("want 1 series got %d", len(m.Metric))
+		}
+		for _, label := range m.Metric[0].Label {
+			if label.GetName() == "route" && label.GetValue() != "api_v1_rules" {
+				t.Errorf("want route label api_v1_rules got %s", label.GetValue())
+			}
+		}
+		if m.Metric[0].GetCounter().GetValue() != 2 {
+			t.Errorf("want 2 requests got %v", m.Metric[0].GetCounter().GetValue())
 		}
+		return
+	}
+	t.Errorf("expected test_route_prefix_requests_total to be in the list of gathered metrics")
+}
+
+// With PrometheusMetrics, requests to a catch-all PathPrefix route are labeled by their full path. The
+// cortex and loki dashboards rely on this, e.g. with route=~"api_v1_query.*".
+func TestPrometheusMetrics_pathLabel(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(PrometheusMetrics("test_path_prefix"))
+	router.PathPrefix("/api/v1").HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		// nothing to do here
+	})
+	router.PathPrefix("/loki/api/v1/").HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		// nothing to do here
+	})
+
+	for _, path := range []string{"/api/v1/query_range", "/api/v1/query", "/loki/api/v1/query_range"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
 	}
 
-	if fail {
-		t.Errorf("expected %s to be in the list of gathered metrics", metricName)
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Errorf("got %v", err)
+	}
+	routes := map[string]bool{}
+	for _, m := range metrics {
+		if m.GetName() != "test_path_prefix_requests_total" {
+			continue
+		}
+		for _, metric := range m.Metric {
+			for _, label := range metric.Label {
+				if label.GetName() == "route" {
+					routes[label.GetValue()] = true
+				}
+			}
+		}
+	}
+	for _, expected := range []string{"api_v1_query_range", "api_v1_query", "loki_api_v1_query_range"} {
+		if !routes[expected] {
+			t.Errorf("want series with route %s, got %v", expected, routes)
+		}
 	}
 }
@@ -65,6 +65,8 @@ type TenantReverseProxy struct {
 	backendURL               *url.URL
 	revproxy                 *httputil.ReverseProxy
 	disableAPIAuthentication bool
+	readLimiter              *TenantRateLimiter
+	writeLimiter             *TenantRateLimiter
 }
 
 func NewReverseProxyFixedTenant(
@@ -73,11 +75,11 @@ func NewReverseProxyFixedTenant(
 	backendURL *url.URL,
 	disableAPIAuthentication bool) *TenantReverseProxy {
 	trp := &TenantReverseProxy{
-		&tenantName,
-		headerName,
-		backendURL,
-		httputil.NewSingleHostReverseProxy(backendURL),
-		disableAPIAuthentication,
+		tenantName:               &tenantName,
+		headerName:               headerName,
+		backendURL:               backendURL,
+		revproxy:                 httputil.NewSingleHostReverseProxy(backendURL),
+		disableAPIAuthentication: disableAPIAuthentication,
 	}
 	trp.revproxy.ErrorHandler = proxyErrorHandler
 	if backendURL.Path != "" && backendURL.Path != "/" {
@@ -91,11 +93,11 @@ func NewReverseProxyDynamicTenant(
 	backendURL *url.URL,
 	disableAPIAuthentication bool) *TenantReverseProxy {
 	trp := &TenantReverseProxy{
-		nil,
-		headerName,
-		backendURL,
-		httputil.NewSingleHostReverseProxy(backendURL),
-		disableAPIAuthentication,
+		tenantName:               nil,
+		headerName:               headerName,
+		backendURL:               backendURL,
+		revproxy:                 httputil.NewSingleHostReverseProxy(backendURL),
+		disableAPIAuthentication: disableAPIAuthentication,
 	}
 	trp.revproxy.ErrorHandler = proxyErrorHandler
 	if backendURL.Path != "" && backendURL.Path != "/" {
@@ -124,7 +126,10 @@ func pathReplacementDirector(backendURL *url.URL, reqPathReplacement func(*url.U
 		// CUSTOM PATH LOGIC vs stock NewSingleHostReverseProxy.Director, which only supports appends
 		origPath := req.URL.Path
 		req.URL.Path = reqPathReplacement(req.URL)
-		log.Debugf("Redirecting req=%s to dest=%s%s", origPath, backendURL.Host, req.URL.Path)
+		Logger(req.Context()).WithFields(log.Fields{
+			"path": origPath,
+			"dest": backendURL.Host + req.URL.Path,
+		}).Debug("Redirecting request")
 		if req.URL.RawPath != "" {
 			// Also update RawPath with escaped version of replacement
 			req.URL.RawPath = url.PathEscape(req.URL.Path)
@@ -149,6 +154,15 @@ func (trp *TenantReverseProxy) ReplaceResponses(f func(req *http.Response) error
 	return trp
 }
 
+// Updates the proxy to rate limit requests per tenant, after the tenant has been determined.
+// GET/HEAD/OPTIONS requests count against `read`, and all other methods against `write`.
+// Either limiter may be nil to leave that kind of request unlimited.
+func (trp *TenantReverseProxy) RateLimit(read *TenantRateLimiter, write *TenantRateLimiter) *TenantReverseProxy {
+	trp.readLimiter = read
+	trp.writeLimiter = write
+	return trp
+}
+
 func (trp *TenantReverseProxy) HandleWithProxy(w http.ResponseWriter, r *http.Request) {
 	tenantName, ok := authenticator.GetTenantNameOr401(w, r, trp.tenantName, trp.disableAPIAuthentication)
 	if !ok {
@@ -156,20 +170,48 @@ func (trp *TenantReverseProxy) HandleWithProxy(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	limiter := trp.writeLimiter
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		limiter = trp.readLimiter
+	}
+	if limiter != nil {
+		if allowed, retryAfter := limiter.Allow(tenantName); !allowed {
+			Logger(r.Context()).WithFields(log.Fields{
+				"tenant": tenantName,
+				"method": r.Method,
+				"path":   r.URL.Path,
+			}).Info("rate limit exceeded")
+			exit429(w, tenantName, retryAfter)
+			return
+		}
+	}
+
 	// Add the tenant in the request header and then forward the request to the backend.
 	r.Header.Set(trp.headerName, tenantName)
 	trp.revproxy.ServeHTTP(w, r)
 }
 
 func proxyErrorHandler(resp http.ResponseWriter, r *http.Request, proxyerr error) {
+	logger := Logger(r.Context())
+	if isBodyTooLarge(proxyerr) {
+		// The request body was streamed past the MaxBodyBytes limit, not a backend problem.
+		logger.WithField("path", r.URL.Path).Infof("http: proxy error: %s", proxyerr)
+		resp.WriteHeader(http.StatusRequestEntityTooLarge)
+		if _, werr := resp.Write([]byte(proxyerr.Error())); werr != nil {
+			logger.Errorf("writing response failed: %v", werr)
+		}
+		return
+	}
+
 	// Native error handler behavior: set status and log
 	resp.WriteHeader(http.StatusBadGateway)
-	log.Warnf("http: proxy error: %s", proxyerr)
+	logger.WithField("path", r.URL.Path).Warnf("http: proxy error: %s", proxyerr)
 
 	// Additional: write string representation of proxy error (as bytes) to
 	// response stream. Log when that fails.
 	_, werr := resp.Write([]byte(proxyerr.Error()))
 	if werr != nil {
-		log.Errorf("writing response failed: %v", werr)
+		logger.Errorf("writing response failed: %v", werr)
 	}
 }
@@ -0,0 +1,129 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// Lower bound for how long a tenant must be idle before its bucket is dropped by RunCleanup.
+const minIdleTimeout = 10 * time.Minute
+
+// TenantRateLimiter keeps an in-memory token bucket for each tenant.
+// Tenants that have been idle for a while can be dropped with RemoveIdle.
+type TenantRateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu      sync.Mutex
+	tenants map[string]*tenantBucket
+}
+
+type tenantBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewTenantRateLimiter returns a limiter that allows each tenant `perSecond` requests per second on
+// average, with bursts of up to `burst` requests.
+func NewTenantRateLimiter(perSecond float64, burst int) *TenantRateLimiter {
+	return &TenantRateLimiter{
+		limit:   rate.Limit(perSecond),
+		burst:   burst,
+		tenants: make(map[string]*tenantBucket),
+	}
+}
+
+// Allow consumes a token for `tenant` if one is available. Otherwise it returns false along with how
+// long the caller should wait before retrying.
+func (l *TenantRateLimiter) Allow(tenant string) (bool, time.Duration) {
+	now := time.Now()
+
+	l.mu.Lock()
+	bucket, ok := l.tenants[tenant]
+	if !ok {
+		bucket = &tenantBucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.tenants[tenant] = bucket
+	}
+	bucket.lastSeen = now
+	l.mu.Unlock()
+
+	reservation := bucket.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		// Only happens with a burst of zero: nothing will ever be allowed.
+		return false, time.Duration(math.MaxInt64)
+	}
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		// Give the token back, since the request isn't going to be served.
+		reservation.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// RemoveIdle drops the buckets of tenants that haven't made a request within `maxIdle`.
+// A dropped tenant starts over with a full bucket, so `maxIdle` should be well above the time it
+// takes for a bucket to refill.
+func (l *TenantRateLimiter) RemoveIdle(maxIdle time.Duration) {
+	cutoff := time.Now().Add(-maxIdle)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for tenant, bucket := range l.tenants {
+		if bucket.lastSeen.Before(cutoff) {
+			delete(l.tenants, tenant)
+		}
+	}
+}
+
+// RunCleanup periodically drops tenants that have been idle for long enough that their bucket would
+// have refilled anyway, see idleTimeout. Does not return.
+func (l *TenantRateLimiter) RunCleanup() {
+	maxIdle := l.idleTimeout()
+	ticker := time.NewTicker(maxIdle)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.RemoveIdle(maxIdle)
+	}
+}
+
+// Returns twice the time it takes for an empty bucket to refill, but at least minIdleTimeout.
+func (l *TenantRateLimiter) idleTimeout() time.Duration {
+	refill := time.Duration(float64(l.burst) / float64(l.limit) * float64(time.Second))
+	if refill <= 0 || 2*refill < minIdleTimeout {
+		return minIdleTimeout
+	}
+	return 2 * refill
+}
+
+// Writes a 429 response with a Retry-After header in whole seconds, rounded up.
+func exit429(w http.ResponseWriter, tenantName string, retryAfter time.Duration) {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", seconds))
+	w.WriteHeader(http.StatusTooManyRequests)
+	_, werr := fmt.Fprintf(w, "rate limit exceeded for tenant %s, retry after %ds", tenantName, seconds)
+	if werr != nil {
+		log.Errorf("writing response failed: %v", werr)
+	}
+}
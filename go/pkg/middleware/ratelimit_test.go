@@ -0,0 +1,94 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantRateLimiter_perTenant(t *testing.T) {
+	// Effectively no refill during the test
+	l := NewTenantRateLimiter(0.001, 2)
+
+	for i := 0; i < 2; i++ {
+		allowed, _ := l.Allow("a")
+		assert.True(t, allowed)
+	}
+	allowed, retryAfter := l.Allow("a")
+	assert.False(t, allowed)
+	assert.Greater(t, int64(retryAfter), int64(time.Second))
+
+	// Other tenants have their own bucket
+	allowed, _ = l.Allow("b")
+	assert.True(t, allowed)
+}
+
+func TestTenantRateLimiter_removeIdle(t *testing.T) {
+	l := NewTenantRateLimiter(0.001, 1)
+	allowed, _ := l.Allow("a")
+	assert.True(t, allowed)
+
+	l.RemoveIdle(time.Hour)
+	assert.Len(t, l.tenants, 1)
+
+	l.RemoveIdle(0)
+	assert.Empty(t, l.tenants)
+
+	// Bucket starts over
+	allowed, _ = l.Allow("a")
+	assert.True(t, allowed)
+}
+
+func TestTenantRateLimiter_idleTimeout(t *testing.T) {
+	// Refills within seconds
+	assert.Equal(t, minIdleTimeout, NewTenantRateLimiter(10, 20).idleTimeout())
+	// 100 requests at one per minute take 100 minutes to refill
+	assert.Equal(t, 200*time.Minute, NewTenantRateLimiter(1.0/60, 100).idleTimeout())
+}
+
+func TestReverseProxy_rateLimit(t *testing.T) {
+	upstreamURL, upstreamClose := createUpstreamTenantEcho(tenantName, t)
+	defer upstreamClose()
+
+	disableAPIAuth := true
+	rp := NewReverseProxyFixedTenant(
+		tenantName,
+		tenantHeaderName,
+		upstreamURL,
+		disableAPIAuth,
+	).RateLimit(nil, NewTenantRateLimiter(0.001, 1))
+
+	// Reads are unlimited
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		rp.HandleWithProxy(w, httptest.NewRequest("GET", "http://localhost", nil))
+		assert.Equal(t, 200, w.Result().StatusCode)
+	}
+
+	w := httptest.NewRecorder()
+	rp.HandleWithProxy(w, httptest.NewRequest("POST", "http://localhost", nil))
+	assert.Equal(t, 200, w.Result().StatusCode)
+
+	w = httptest.NewRecorder()
+	rp.HandleWithProxy(w, httptest.NewRequest("POST", "http://localhost", nil))
+	resp := w.Result()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+}
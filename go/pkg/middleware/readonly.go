@@ -0,0 +1,38 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// ReadOnly rejects any request that isn't a GET, HEAD, or OPTIONS with a 403, for running an instance
+// that can be used to inspect configuration without any risk of changing it.
+func ReadOnly() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+			default:
+				Logger(r.Context()).WithField("path", r.URL.Path).Infof("rejecting %s in read-only mode", r.Method)
+				http.Error(w, fmt.Sprintf("%s not allowed: server is in read-only mode", r.Method), http.StatusForbidden)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestReadOnly(t *testing.T) {
+	tests := []struct {
+		method       string
+		expectedCode int
+	}{
+		{"GET", http.StatusOK},
+		{"HEAD", http.StatusOK},
+		{"OPTIONS", http.StatusOK},
+		{"POST", http.StatusForbidden},
+		{"PUT", http.StatusForbidden},
+		{"PATCH", http.StatusForbidden},
+		{"DELETE", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		router := mux.NewRouter()
+		router.Use(ReadOnly())
+		router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, "/api/v1/rules", nil))
+
+		if w.Code != tt.expectedCode {
+			t.Errorf("%s: want status %d got %d", tt.method, tt.expectedCode, w.Code)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader is read from incoming requests and echoed in responses by RequestID.
+const RequestIDHeader = "X-Request-ID"
+
+// Incoming request IDs are logged and forwarded to backends, so only reasonably short IDs made of safe
+// characters are accepted. Anything else is replaced with a generated ID.
+var requestIDRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+type loggerKey struct{}
+
+// RequestID honors an incoming X-Request-ID header, or generates a new UUID when it is absent or
+// invalid (longer than 128 characters, or characters other than [A-Za-z0-9._-]). The ID is set on
+// the request (so that reverse proxies forward it to their backends), echoed in the response, and
+// attached as a "request_id" field to the logger returned by Logger.
+func RequestID() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get(RequestIDHeader)
+			if !requestIDRegexp.MatchString(requestID) {
+				requestID = uuid.New().String()
+				r.Header.Set(RequestIDHeader, requestID)
+			}
+			w.Header().Set(RequestIDHeader, requestID)
+
+			logger := log.WithField("request_id", requestID)
+			ctx := context.WithValue(r.Context(), loggerKey{}, logger)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Logger returns the request-scoped logger set up by RequestID, or the standard logger if there
+// isn't one in `ctx`.
+func Logger(ctx context.Context) *log.Entry {
+	if logger, ok := ctx.Value(loggerKey{}).(*log.Entry); ok {
+		return logger
+	}
+	return log.NewEntry(log.StandardLogger())
+}
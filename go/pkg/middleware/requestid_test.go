@@ -0,0 +1,91 @@
+// Copyright 2021 Opstrace, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func TestRequestID(t *testing.T) {
+	var loggedID interface{}
+	router := mux.NewRouter()
+	router.Use(RequestID())
+	router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loggedID = Logger(r.Context()).Data["request_id"]
+	})
+
+	// Provided by client
+	r := httptest.NewRequest("GET", "/test", nil)
+	r.Header.Set(RequestIDHeader, "abc123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if got := w.Header().Get(RequestIDHeader); got != "abc123" {
+		t.Errorf("want echoed request ID abc123, got %q", got)
+	}
+	if loggedID != "abc123" {
+		t.Errorf("want logger request_id abc123, got %v", loggedID)
+	}
+
+	// Generated
+	r = httptest.NewRequest("GET", "/test", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	generated := w.Header().Get(RequestIDHeader)
+	if generated == "" {
+		t.Errorf("expected a generated request ID")
+	}
+	if loggedID != generated {
+		t.Errorf("want logger request_id %q, got %v", generated, loggedID)
+	}
+}
+
+func TestRequestID_invalid(t *testing.T) {
+	var forwardedID string
+	router := mux.NewRouter()
+	router.Use(RequestID())
+	router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedID = r.Header.Get(RequestIDHeader)
+	})
+
+	for _, invalid := range []string{strings.Repeat("a", 129), "abc 123", "abc\"}", "abc/../def"} {
+		r := httptest.NewRequest("GET", "/test", nil)
+		r.Header.Set(RequestIDHeader, invalid)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		got := w.Header().Get(RequestIDHeader)
+		if _, err := uuid.Parse(got); err != nil {
+			t.Errorf("want generated request ID in place of %q, got %q", invalid, got)
+		}
+		if forwardedID != got {
+			t.Errorf("want forwarded request ID %q, got %q", got, forwardedID)
+		}
+	}
+}
+
+func TestLoggerWithoutRequestID(t *testing.T) {
+	if logger := Logger(context.Background()); logger == nil {
+		t.Errorf("expected fallback logger")
+	}
+}